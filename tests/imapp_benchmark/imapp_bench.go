@@ -1,11 +1,13 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"math"
 	"math/big"
 	"os"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -13,8 +15,10 @@ import (
 	_ "unsafe"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/core/vm/runtime"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/params"
@@ -24,22 +28,329 @@ var result []byte
 var bytecode []byte
 var bytecodeStore string
 
+// CLI-controlled overrides applied to cfg before setDefaults fills in
+// whatever is left nil/zero. Left nil/zero themselves, they reproduce the
+// historical hardcoded behavior exactly.
+var (
+	chainConfigOverride *params.ChainConfig
+	gasLimitOverride    uint64
+	gasPriceOverride    *big.Int
+	valueOverride       *big.Int
+	blockNumberOverride *big.Int
+	baseFeeOverride     *big.Int
+	difficultyOverride  *big.Int
+	timeOverride        *big.Int
+)
+
+// forkOrder lists every mainnet fork in activation order, including the
+// ones the -fork help text doesn't list (all of them are accepted by -fork),
+// so that selecting e.g. Istanbul also activates Constantinople/Petersburg
+// in between.
+var forkOrder = []string{
+	"Homestead", "DAO", "EIP150", "EIP155", "EIP158",
+	"Byzantium", "Constantinople", "Petersburg",
+	"Istanbul", "MuirGlacier", "Berlin", "London",
+}
+
+// buildChainConfig returns a params.ChainConfig with fork, and every fork
+// before it, activated at block 0, leaving later forks unset. This lets the
+// benchmark measure opcode costs as they stood at a given hard fork instead
+// of always running under every fork ever shipped.
+func buildChainConfig(fork string, chainID int64) (*params.ChainConfig, error) {
+	idx := -1
+	for i, name := range forkOrder {
+		if name == fork {
+			idx = i
+			break
+		}
+	}
+	if idx == -1 {
+		return nil, fmt.Errorf("unknown -fork %q, want one of %s", fork, strings.Join(forkOrder, ", "))
+	}
+
+	activated := make(map[string]bool, idx+1)
+	for i := 0; i <= idx; i++ {
+		activated[forkOrder[i]] = true
+	}
+
+	cfg := &params.ChainConfig{ChainID: big.NewInt(chainID)}
+	if activated["Homestead"] {
+		cfg.HomesteadBlock = new(big.Int)
+	}
+	if activated["DAO"] {
+		// DAOForkSupport left false to match setDefaults' historical
+		// default; it signals a node's stance on the DAO fork, not
+		// anything that affects bytecode execution here.
+		cfg.DAOForkBlock = new(big.Int)
+	}
+	if activated["EIP150"] {
+		cfg.EIP150Block = new(big.Int)
+	}
+	if activated["EIP155"] {
+		cfg.EIP155Block = new(big.Int)
+	}
+	if activated["EIP158"] {
+		cfg.EIP158Block = new(big.Int)
+	}
+	if activated["Byzantium"] {
+		cfg.ByzantiumBlock = new(big.Int)
+	}
+	if activated["Constantinople"] {
+		cfg.ConstantinopleBlock = new(big.Int)
+	}
+	if activated["Petersburg"] {
+		cfg.PetersburgBlock = new(big.Int)
+	}
+	if activated["Istanbul"] {
+		cfg.IstanbulBlock = new(big.Int)
+	}
+	if activated["MuirGlacier"] {
+		cfg.MuirGlacierBlock = new(big.Int)
+	}
+	if activated["Berlin"] {
+		cfg.BerlinBlock = new(big.Int)
+	}
+	if activated["London"] {
+		cfg.LondonBlock = new(big.Int)
+	}
+	return cfg, nil
+}
+
+// parseBigIntFlag parses a decimal -flagname value, returning nil (meaning
+// "let setDefaults pick") when s is empty.
+func parseBigIntFlag(name, s string) (*big.Int, error) {
+	if s == "" {
+		return nil, nil
+	}
+	v, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid -%s %q", name, s)
+	}
+	return v, nil
+}
+
+// calldataOverride, when non-nil, replaces the benchmark's synthetic 128KB
+// of '{' so realistic contract calls can be measured instead of only
+// self-contained memory-copy bytecode.
+var calldataOverride []byte
+
+// loadCalldata resolves -input into calldata bytes. s may be raw hex or, if
+// prefixed with '@', a path to a file containing hex (as produced by e.g.
+// `cast calldata` or cmd/evm --input @file.hex).
+func loadCalldata(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(s, "@") {
+		data, err := os.ReadFile(s[1:])
+		if err != nil {
+			return nil, fmt.Errorf("reading -input file: %w", err)
+		}
+		s = strings.TrimSpace(string(data))
+	}
+	s = strings.TrimPrefix(s, "0x")
+	return common.Hex2Bytes(s), nil
+}
+
+// prestateAlloc, when non-nil, is applied to cfg.State before execution so
+// the benchmarked bytecode can read storage or rely on account state that
+// pre-existed the call, rather than always starting from an empty trie.
+var prestateAlloc core.GenesisAlloc
+
+// loadPrestate reads -prestate, a JSON map of address to
+// {balance, nonce, code, storage} in the same layout cmd/evm --prestate
+// accepts.
+func loadPrestate(path string) (core.GenesisAlloc, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading -prestate file: %w", err)
+	}
+	var alloc core.GenesisAlloc
+	if err := json.Unmarshal(data, &alloc); err != nil {
+		return nil, fmt.Errorf("parsing -prestate file: %w", err)
+	}
+	return alloc, nil
+}
+
+// applyPrestate seeds statedb with the accounts, code and storage from a
+// loaded -prestate file.
+func applyPrestate(statedb *state.StateDB, alloc core.GenesisAlloc) {
+	for addr, account := range alloc {
+		statedb.SetBalance(addr, account.Balance)
+		statedb.SetNonce(addr, account.Nonce)
+		statedb.SetCode(addr, account.Code)
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+}
+
+// profileEnabled turns on the per-opcode tracer installed by -profile. Left
+// false, BenchmarkBytecodeExecution never touches cfg.EVMConfig.Tracer so
+// the untraced path stays exactly as cheap as before this existed.
+var profileEnabled bool
+
+// lastProfileStats holds the stats gathered by the most recent
+// profilingTracer, read by runOverheadBenchmark once testing.Benchmark
+// returns.
+var lastProfileStats map[vm.OpCode]*opcodeStats
+
+// opcodeStats accumulates per-opcode cost across all of a benchmark's b.N
+// iterations.
+type opcodeStats struct {
+	calls    uint64
+	ns       int64
+	gas      uint64
+	maxMem   int
+	maxStack int
+}
+
+// profilingTracer is a vm.EVMLogger that records per-opcode call counts,
+// wall-clock time and gas instead of printing a trace. CaptureState fires
+// once per opcode, just before it executes, so the time between one
+// CaptureState call and the next approximates that opcode's cost; it is
+// booked to the opcode that was current when the clock started.
+type profilingTracer struct {
+	stats      map[vm.OpCode]*opcodeStats
+	pending    vm.OpCode
+	pendingGas uint64
+	start      time.Time
+	have       bool
+}
+
+func newProfilingTracer() *profilingTracer {
+	return &profilingTracer{stats: make(map[vm.OpCode]*opcodeStats)}
+}
+
+func (t *profilingTracer) statFor(op vm.OpCode) *opcodeStats {
+	s, ok := t.stats[op]
+	if !ok {
+		s = new(opcodeStats)
+		t.stats[op] = s
+	}
+	return s
+}
+
+func (t *profilingTracer) flush(now time.Time) {
+	if !t.have {
+		return
+	}
+	s := t.statFor(t.pending)
+	s.calls++
+	s.ns += now.Sub(t.start).Nanoseconds()
+	s.gas += t.pendingGas
+}
+
+func (t *profilingTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.have = false
+}
+
+func (t *profilingTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	now := time.Now()
+	t.flush(now)
+
+	t.pending = op
+	t.pendingGas = cost
+	t.start = now
+	t.have = true
+
+	s := t.statFor(op)
+	if mem := scope.Memory.Len(); mem > s.maxMem {
+		s.maxMem = mem
+	}
+	if stack := len(scope.Stack.Data()); stack > s.maxStack {
+		s.maxStack = stack
+	}
+}
+
+func (t *profilingTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	t.flush(time.Now())
+	t.have = false
+}
+
+func (t *profilingTracer) CaptureEnd(output []byte, gasUsed uint64, tm time.Duration, err error) {
+	t.flush(time.Now())
+	t.have = false
+}
+
+func (t *profilingTracer) CaptureEnter(typ vm.OpCode, from, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *profilingTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+}
+
+// printProfile emits the per-opcode CSV block requested by -profile,
+// alongside (not instead of) the regular overhead CSV rows.
+func printProfile(stats map[vm.OpCode]*opcodeStats) {
+	fmt.Println("opcode,calls,totalNs,avgNs,totalGas,maxMemBytes,maxStackDepth")
+	for op, s := range stats {
+		var avgNs int64
+		if s.calls > 0 {
+			avgNs = s.ns / int64(s.calls)
+		}
+		fmt.Printf("%v,%v,%v,%v,%v,%v,%v\n", op, s.calls, s.ns, avgNs, s.gas, s.maxMem, s.maxStack)
+	}
+}
+
+// modeInterp is the only value -mode ever resolves to.
+const modeInterp = "interp"
+
+// validateMode rejects anything other than "interp". The backlog item this
+// flag was added for asked for a real interp-vs-jit comparison, but
+// go-ethereum's JIT interpreter, and the cmd/evm --forcejit/--nojit flag
+// pair this harness's -mode mirrors, were both removed years before this
+// package existed: there is no second backend to select between, so -mode
+// exists only to fail loudly instead of silently running the interpreter
+// twice under different labels.
+func validateMode(s string) error {
+	switch s {
+	case modeInterp:
+		return nil
+	case "jit", "both":
+		return fmt.Errorf("-mode %q: no alternate JIT backend exists in this build of go-ethereum (it was removed years ago); only -mode interp is supported", s)
+	default:
+		return fmt.Errorf("unknown -mode %q, want interp", s)
+	}
+}
+
 func BenchmarkBytecodeExecution(b *testing.B) {
 	var calldata []byte
 
 	cfg := new(runtime.Config)
+	cfg.ChainConfig = chainConfigOverride
+	cfg.GasLimit = gasLimitOverride
+	cfg.GasPrice = gasPriceOverride
+	cfg.Value = valueOverride
+	cfg.BlockNumber = blockNumberOverride
+	cfg.BaseFee = baseFeeOverride
+	cfg.Difficulty = difficultyOverride
+	cfg.Time = timeOverride
 	setDefaults(cfg)
 	// from `github.com/ethereum/go-ethereum/core/vm/runtime/runtime.go:109`
 	cfg.State, _ = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if prestateAlloc != nil {
+		applyPrestate(cfg.State, prestateAlloc)
+	}
 
-	// Initialize some constant calldata of 128KB, 2^17 bytes.
-	// This means, if we offset between 0th and 2^16th byte, we can fetch between 0 and 2^16 bytes (64KB)
-	// In consequence, we need args to memory-copying OPCODEs to be between 0 and 2^16, 2^16 fits in a PUSH3,
-	// which we'll be using to generate arguments for those OPCODEs.
-	calldata = []byte(strings.Repeat("{", 1<<17))
+	if calldataOverride != nil {
+		calldata = calldataOverride
+	} else {
+		// Initialize some constant calldata of 128KB, 2^17 bytes.
+		// This means, if we offset between 0th and 2^16th byte, we can fetch between 0 and 2^16 bytes (64KB)
+		// In consequence, we need args to memory-copying OPCODEs to be between 0 and 2^16, 2^16 fits in a PUSH3,
+		// which we'll be using to generate arguments for those OPCODEs.
+		calldata = []byte(strings.Repeat("{", 1<<17))
+	}
 
 	cfg.EVMConfig.Debug = false
 
+	var tracer *profilingTracer
+	if profileEnabled {
+		tracer = newProfilingTracer()
+		cfg.EVMConfig.Debug = true
+		cfg.EVMConfig.Tracer = tracer
+	}
+
 	b.ResetTimer()
 
 	var exBytes []byte
@@ -53,6 +364,10 @@ func BenchmarkBytecodeExecution(b *testing.B) {
 		}
 	}
 
+	if tracer != nil {
+		lastProfileStats = tracer.stats
+	}
+
 	//prevents compiler optimization, see https://dave.cheney.net/2013/06/30/how-to-write-benchmarks-in-go
 	result = exBytes
 }
@@ -109,17 +424,128 @@ func setDefaults(cfg *runtime.Config) {
 	}
 }
 
-func runOverheadBenchmark(sampleSize int) {
-	for i := 1; i <= sampleSize; i++ {
+func runOverheadBenchmark(sampleSize int, warmup int, trimPct float64) {
+	samples := make([]sampleStat, 0, sampleSize)
 
+	for i := 1; i <= sampleSize; i++ {
 		bytecode = common.Hex2Bytes("00" + bytecodeStore)
 		rEmpty := testing.Benchmark(BenchmarkBytecodeExecution)
+		if profileEnabled {
+			// The empty-bytecode run has the same tracer attached, so its
+			// ns/op is the "with-tracer" observer overhead to subtract.
+			fmt.Printf("# with-tracer overhead (ns/op), sample %v: %v\n", i, rEmpty.NsPerOp())
+		}
 
 		bytecode = common.Hex2Bytes(bytecodeStore)
 		rActual := testing.Benchmark(BenchmarkBytecodeExecution)
+		if profileEnabled {
+			printProfile(lastProfileStats)
+		}
 
 		outputOverheadResults(i, rEmpty, rActual)
+		samples = append(samples, sampleStat{
+			executionLoopTime: rActual.NsPerOp() - rEmpty.NsPerOp(),
+			allocs:            rActual.AllocsPerOp(),
+			bytes:             rActual.AllocedBytesPerOp(),
+		})
+	}
+
+	printSummary(samples, warmup, trimPct)
+}
+
+// sampleStat is the subset of a sample's results that feeds the -warmup/
+// -trim aggregation.
+type sampleStat struct {
+	executionLoopTime int64
+	allocs            int64
+	bytes             int64
+}
+
+// trimOutliers drops the top and bottom pct% of a sorted slice.
+func trimOutliers(sorted []int64, pct float64) []int64 {
+	if pct <= 0 || len(sorted) == 0 {
+		return sorted
+	}
+	cut := int(float64(len(sorted)) * pct / 100)
+	if 2*cut >= len(sorted) {
+		return sorted
+	}
+	return sorted[cut : len(sorted)-cut]
+}
+
+// percentile returns the p-th percentile (0-100) of a sorted slice as the
+// element at index floor((len-1)*p/100); it does not interpolate between
+// neighbouring elements.
+func percentile(sorted []int64, p float64) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p / 100)
+	return sorted[idx]
+}
+
+func meanStddev(vals []int64) (mean, stddev float64) {
+	var sum float64
+	for _, v := range vals {
+		sum += float64(v)
+	}
+	mean = sum / float64(len(vals))
+
+	var sqDiff float64
+	for _, v := range vals {
+		d := float64(v) - mean
+		sqDiff += d * d
+	}
+	stddev = math.Sqrt(sqDiff / float64(len(vals)))
+	return mean, stddev
+}
+
+// trimSampleOutliers drops the top and bottom pct% of samples sorted by
+// executionLoopTime, keeping each sample's allocs/bytes paired with the
+// latency figure they were measured alongside.
+func trimSampleOutliers(sorted []sampleStat, pct float64) []sampleStat {
+	if pct <= 0 || len(sorted) == 0 {
+		return sorted
+	}
+	cut := int(float64(len(sorted)) * pct / 100)
+	if 2*cut >= len(sorted) {
+		return sorted
+	}
+	return sorted[cut : len(sorted)-cut]
+}
+
+// printSummary aggregates samples - after discarding the first warmup of
+// them and trimming trimPct% of outliers off each end of the
+// executionLoopTime distribution - into a single CI-friendly line. The
+// alloc/byte means are computed over that same trimmed set, so they always
+// describe the same samples as the latency percentiles.
+func printSummary(samples []sampleStat, warmup int, trimPct float64) {
+	if warmup < len(samples) {
+		samples = samples[warmup:]
+	} else {
+		samples = nil
+	}
+	if len(samples) == 0 {
+		fmt.Println("# summary: no samples left after warmup")
+		return
+	}
+
+	sort.Slice(samples, func(i, j int) bool { return samples[i].executionLoopTime < samples[j].executionLoopTime })
+	trimmed := trimSampleOutliers(samples, trimPct)
+
+	times := make([]int64, len(trimmed))
+	var allocSum, byteSum int64
+	for i, s := range trimmed {
+		times[i] = s.executionLoopTime
+		allocSum += s.allocs
+		byteSum += s.bytes
 	}
+
+	mean, stddev := meanStddev(times)
+	fmt.Printf("# summary,n=%v,min=%v,median=%v,mean=%.2f,stddev=%.2f,p95=%v,p99=%v,meanAllocsPerOp=%.2f,meanBytesPerOp=%.2f\n",
+		len(trimmed), times[0], percentile(times, 50), mean, stddev,
+		percentile(times, 95), percentile(times, 99),
+		float64(allocSum)/float64(len(trimmed)), float64(byteSum)/float64(len(trimmed)))
 }
 
 func outputOverheadResults(sampleId int, rEmpty testing.BenchmarkResult, rActual testing.BenchmarkResult) {
@@ -131,15 +557,101 @@ func outputOverheadResults(sampleId int, rEmpty testing.BenchmarkResult, rActual
 }
 
 func main() {
+	// Registers testing's own flags (including -test.benchtime) into
+	// flag.CommandLine so -benchtime below can drive it, even though this
+	// binary isn't run via `go test`.
+	testing.Init()
+
 	bytecodePtr := flag.String("bytecode", "", "EVM bytecode to execute and measure")
 	sampleSizePtr := flag.Int("sampleSize", 1, "Size of the sample - number of measured repetitions of execution")
+	modePtr := flag.String("mode", modeInterp, "EVM backend to benchmark; only interp is available")
+	forkPtr := flag.String("fork", "", "Fork rules to execute under: Homestead, Byzantium, Istanbul, Berlin, London (default: every fork active at block 0)")
+	chainIDPtr := flag.Int64("chainid", 1, "Chain ID")
+	gasLimitPtr := flag.Uint64("gaslimit", 0, "Gas limit for the execution (default: math.MaxUint64)")
+	gasPricePtr := flag.String("gasprice", "", "Gas price, in wei")
+	valuePtr := flag.String("value", "", "Call value, in wei")
+	blockNumberPtr := flag.String("blocknumber", "", "Block number")
+	baseFeePtr := flag.String("basefee", "", "Base fee, in wei (default: params.InitialBaseFee)")
+	difficultyPtr := flag.String("difficulty", "", "Block difficulty")
+	timePtr := flag.String("time", "", "Block timestamp (default: now)")
+	inputPtr := flag.String("input", "", "Calldata, as raw hex or @filename (default: synthetic 128KB of '{')")
+	prestatePtr := flag.String("prestate", "", "JSON file of address -> {balance, nonce, code, storage} to preload before execution")
+	profilePtr := flag.Bool("profile", false, "Install a tracer and emit a per-opcode timing/gas CSV block alongside the overhead numbers")
+	warmupPtr := flag.Int("warmup", 0, "Discard the first N samples before aggregating")
+	trimPtr := flag.Float64("trim", 0, "Drop the top/bottom P percent of samples (by executionLoopTime) before aggregating")
+	benchtimePtr := flag.String("benchtime", "", "Per-sample minimum benchmark duration or iteration count, e.g. 100ms or 100x (passed through to testing.Benchmark)")
 
 	flag.Parse()
 
+	profileEnabled = *profilePtr
+
+	if *benchtimePtr != "" {
+		if err := flag.Set("test.benchtime", *benchtimePtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
 	bytecodeStore = *bytecodePtr
 	sampleSize := *sampleSizePtr
 
-	runOverheadBenchmark(sampleSize)
+	if err := validateMode(*modePtr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var err error
+	visited := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { visited[f.Name] = true })
+
+	if visited["fork"] || visited["chainid"] {
+		fork := *forkPtr
+		if fork == "" {
+			// Reproduces setDefaults' historical default: every fork active
+			// at block 0.
+			fork = forkOrder[len(forkOrder)-1]
+		}
+		chainConfigOverride, err = buildChainConfig(fork, *chainIDPtr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	gasLimitOverride = *gasLimitPtr
+	for _, p := range []struct {
+		name string
+		s    string
+		dst  **big.Int
+	}{
+		{"gasprice", *gasPricePtr, &gasPriceOverride},
+		{"value", *valuePtr, &valueOverride},
+		{"blocknumber", *blockNumberPtr, &blockNumberOverride},
+		{"basefee", *baseFeePtr, &baseFeeOverride},
+		{"difficulty", *difficultyPtr, &difficultyOverride},
+		{"time", *timePtr, &timeOverride},
+	} {
+		v, err := parseBigIntFlag(p.name, p.s)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		*p.dst = v
+	}
+
+	calldataOverride, err = loadCalldata(*inputPtr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *prestatePtr != "" {
+		prestateAlloc, err = loadPrestate(*prestatePtr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	runOverheadBenchmark(sampleSize, *warmupPtr, *trimPtr)
 
 	//prevents compiler optimization
 	if result != nil {
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBuildChainConfig(t *testing.T) {
+	cfg, err := buildChainConfig("Byzantium", 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.ChainID.Cmp(big.NewInt(5)) != 0 {
+		t.Errorf("ChainID = %v, want 5", cfg.ChainID)
+	}
+	if cfg.HomesteadBlock == nil || cfg.ByzantiumBlock == nil {
+		t.Errorf("expected Homestead and Byzantium to be activated, got %+v", cfg)
+	}
+	if cfg.IstanbulBlock != nil || cfg.BerlinBlock != nil || cfg.LondonBlock != nil {
+		t.Errorf("expected forks after Byzantium to stay unset, got %+v", cfg)
+	}
+	if cfg.DAOForkSupport {
+		t.Errorf("DAOForkSupport = true, want false")
+	}
+
+	if _, err := buildChainConfig("NotAFork", 1); err == nil {
+		t.Error("expected an error for an unknown fork name")
+	}
+}
+
+func TestParseBigIntFlag(t *testing.T) {
+	if v, err := parseBigIntFlag("value", ""); err != nil || v != nil {
+		t.Errorf("parseBigIntFlag(\"\") = %v, %v, want nil, nil", v, err)
+	}
+	v, err := parseBigIntFlag("value", "42")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if v.Cmp(big.NewInt(42)) != 0 {
+		t.Errorf("parseBigIntFlag(\"42\") = %v, want 42", v)
+	}
+	if _, err := parseBigIntFlag("value", "not-a-number"); err == nil {
+		t.Error("expected an error for a non-numeric value")
+	}
+}
+
+func TestLoadCalldata(t *testing.T) {
+	if data, err := loadCalldata(""); err != nil || data != nil {
+		t.Errorf("loadCalldata(\"\") = %v, %v, want nil, nil", data, err)
+	}
+
+	data, err := loadCalldata("0xdeadbeef")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []byte{0xde, 0xad, 0xbe, 0xef}; !bytesEqual(data, want) {
+		t.Errorf("loadCalldata(\"0xdeadbeef\") = %x, want %x", data, want)
+	}
+
+	path := filepath.Join(t.TempDir(), "calldata.hex")
+	if err := os.WriteFile(path, []byte("deadbeef\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	data, err = loadCalldata("@" + path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []byte{0xde, 0xad, 0xbe, 0xef}; !bytesEqual(data, want) {
+		t.Errorf("loadCalldata(@file) = %x, want %x", data, want)
+	}
+
+	if _, err := loadCalldata("@" + filepath.Join(t.TempDir(), "missing.hex")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func bytesEqual(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestTrimOutliers(t *testing.T) {
+	sorted := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	if got := trimOutliers(sorted, 0); len(got) != len(sorted) {
+		t.Errorf("trim 0%% = %v, want all samples kept", got)
+	}
+
+	got := trimOutliers(sorted, 20)
+	want := []int64{3, 4, 5, 6, 7, 8}
+	if !int64SliceEqual(got, want) {
+		t.Errorf("trim 20%% = %v, want %v", got, want)
+	}
+
+	// A trim percentage large enough to remove everything leaves the
+	// samples untouched rather than returning an empty slice.
+	if got := trimOutliers(sorted, 60); !int64SliceEqual(got, sorted) {
+		t.Errorf("trim 60%% = %v, want unchanged %v", got, sorted)
+	}
+
+	if got := trimOutliers(nil, 20); got != nil {
+		t.Errorf("trim of nil = %v, want nil", got)
+	}
+}
+
+func int64SliceEqual(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPercentile(t *testing.T) {
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile(nil, 50) = %v, want 0", got)
+	}
+
+	odd := []int64{1, 2, 3, 4, 5}
+	if got := percentile(odd, 50); got != 3 {
+		t.Errorf("percentile(odd, 50) = %v, want 3", got)
+	}
+
+	even := []int64{1, 2, 3, 4}
+	if got := percentile(even, 50); got != 2 {
+		t.Errorf("percentile(even, 50) = %v, want 2", got)
+	}
+	if got := percentile(even, 0); got != 1 {
+		t.Errorf("percentile(even, 0) = %v, want 1", got)
+	}
+	if got := percentile(even, 100); got != 4 {
+		t.Errorf("percentile(even, 100) = %v, want 4", got)
+	}
+}
+
+func TestValidateMode(t *testing.T) {
+	if err := validateMode("interp"); err != nil {
+		t.Errorf("validateMode(\"interp\") = %v, want nil", err)
+	}
+
+	for _, mode := range []string{"jit", "both"} {
+		if err := validateMode(mode); err == nil {
+			t.Errorf("validateMode(%q) = nil, want an error (no alternate backend exists)", mode)
+		}
+	}
+
+	if err := validateMode("bogus"); err == nil {
+		t.Error("validateMode(\"bogus\") = nil, want an error")
+	}
+}
+
+func TestMeanStddev(t *testing.T) {
+	mean, stddev := meanStddev([]int64{2, 4, 4, 4, 5, 5, 7, 9})
+	if mean != 5 {
+		t.Errorf("mean = %v, want 5", mean)
+	}
+	if stddev != 2 {
+		t.Errorf("stddev = %v, want 2", stddev)
+	}
+}